@@ -0,0 +1,36 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import "github.com/sirupsen/logrus"
+
+// babelTransformer adapts the existing Babel-in-goja pipeline to the
+// Transformer interface. It's kept around, and remains the default, because
+// it's the only implementation that covers the full set of plugins listed
+// in DefaultOpts.
+type babelTransformer struct {
+	b      *babel
+	logger logrus.FieldLogger
+}
+
+func (t *babelTransformer) Transform(src, filename string, opts TransformOptions) (string, []byte, error) {
+	return t.b.transformImpl(t.logger, src, filename, opts.SourceMapsEnabled, opts.InputSourceMap)
+}
@@ -0,0 +1,285 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// CacheMode controls how the persistent compiler cache behaves.
+//
+//go:generate enumer -type=CacheMode -trimprefix CacheMode -transform snake -output cache_mode_gen.go
+type CacheMode int
+
+const (
+	// CacheModeOn looks up and stores entries in the persistent cache.
+	CacheModeOn CacheMode = iota
+	// CacheModeOff disables the persistent cache entirely; every Compile call
+	// re-runs Babel and goja.CompileAST.
+	CacheModeOff
+	// CacheModeReadonly looks up entries but never writes new ones, useful for
+	// CI runners that share a read-only, prewarmed cache volume.
+	CacheModeReadonly
+)
+
+// cacheManifestName is the name of the file that records the k6 version the
+// cache directory was populated with, so entries are invalidated on upgrade.
+const cacheManifestName = "manifest.json"
+
+// cacheManifest is the content of cacheManifestName.
+type cacheManifest struct {
+	K6Version string `json:"k6Version"`
+}
+
+// cacheEntry is what gets persisted on disk (and kept in the in-memory LRU)
+// for a single cache hit: the ES5 source and the serialized goja.Program.
+//
+// There's no source map field here: Compile never keeps the source map it
+// generates past the call that produced it (compileImpl's sourceMapLoader
+// stashes it on a throwaway compilationState), so there's nothing to
+// persist. Add one back only once Compile itself returns/accepts a source
+// map.
+type cacheEntry struct {
+	Code    string `json:"code"`
+	Program []byte `json:"program"`
+}
+
+// programCache is a content-addressed, persistent cache of compiled
+// goja.Programs and Babel-transformed sources, fronted by an in-memory LRU so
+// repeated lookups within a single run don't hit disk.
+//
+// It's keyed by the sha256 of the original source plus everything that can
+// change what Compile produces from it (compatibility mode, compiler
+// options, Babel version), so a stale entry can never be returned.
+type programCache struct {
+	dir     string
+	mode    CacheMode
+	maxSize int
+
+	m    sync.Mutex
+	lru  *list.List
+	vals map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	entry *cacheEntry
+}
+
+// newProgramCache prepares dir for use as a persistent compiler cache. It
+// writes (or validates) the version manifest, wiping the directory's
+// contents if it was populated by a different k6 version.
+func newProgramCache(dir, k6Version string, maxSize int) (*programCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("couldn't create compiler cache dir %q: %w", dir, err)
+	}
+
+	manifestPath := filepath.Join(dir, cacheManifestName)
+	existing, err := ioutil.ReadFile(manifestPath) //nolint:gosec
+	switch {
+	case err == nil:
+		var m cacheManifest
+		if json.Unmarshal(existing, &m) != nil || m.K6Version != k6Version {
+			if err := wipeCacheDir(dir); err != nil {
+				return nil, err
+			}
+		}
+	case os.IsNotExist(err):
+		// fresh cache dir, nothing to invalidate
+	default:
+		return nil, err
+	}
+
+	m, err := json.Marshal(cacheManifest{K6Version: k6Version})
+	if err != nil {
+		return nil, err
+	}
+	if err := atomicWriteFile(manifestPath, m); err != nil {
+		return nil, err
+	}
+
+	return &programCache{
+		dir:     dir,
+		mode:    CacheModeOn,
+		maxSize: maxSize,
+		lru:     list.New(),
+		vals:    make(map[string]*list.Element),
+	}, nil
+}
+
+// wipeCacheDir removes every entry from a stale cache directory, without
+// removing the directory itself.
+func wipeCacheDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashKey computes the content-address for a compile unit: the source code,
+// the filename, the compatibility mode and the Babel/transform options all
+// affect the output, so all of them go into the hash.
+func hashKey(src, filename string, compatibilityMode int, opts interface{}) string {
+	h := sha256.New()
+	// babelSrc is embedded at build time, so hashing it ties the key to the
+	// exact Babel build in use, invalidating entries across Babel upgrades.
+	fmt.Fprintf(h, "mode:%d\nfilename:%s\nopts:%v\n", compatibilityMode, filename, opts)
+	h.Write([]byte(babelSrc))
+	h.Write([]byte(src))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get looks up key, first in the in-memory LRU and then, on a miss, on disk.
+func (c *programCache) get(key string) (*cacheEntry, bool) {
+	if c.mode == CacheModeOff {
+		return nil, false
+	}
+
+	c.m.Lock()
+	if el, ok := c.vals[key]; ok {
+		c.lru.MoveToFront(el)
+		entry := el.Value.(*lruEntry).entry
+		c.m.Unlock()
+		return entry, true
+	}
+	c.m.Unlock()
+
+	raw, err := ioutil.ReadFile(c.entryPath(key)) //nolint:gosec
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false
+	}
+
+	c.promote(key, &entry)
+	return &entry, true
+}
+
+// put stores entry under key, both in the in-memory LRU and (unless the
+// cache is readonly) on disk via an atomic write so concurrent VUs
+// compiling the same file never observe a partially written entry.
+func (c *programCache) put(key string, entry *cacheEntry) error {
+	if c.mode == CacheModeOff {
+		return nil
+	}
+	c.promote(key, entry)
+	if c.mode == CacheModeReadonly {
+		return nil
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return atomicWriteFile(c.entryPath(key), raw)
+}
+
+// promote inserts or refreshes key at the front of the in-memory LRU,
+// evicting the least-recently-used entry once maxSize is exceeded.
+func (c *programCache) promote(key string, entry *cacheEntry) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if el, ok := c.vals[key]; ok {
+		el.Value.(*lruEntry).entry = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	el := c.lru.PushFront(&lruEntry{key: key, entry: entry})
+	c.vals[key] = el
+
+	if c.maxSize <= 0 {
+		return
+	}
+	for c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.lru.Remove(oldest)
+		delete(c.vals, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *programCache) entryPath(key string) string {
+	// two levels of sharding keep any single directory from accumulating
+	// tens of thousands of entries.
+	return filepath.Join(c.dir, key[0:2], key[2:4], key+".json")
+}
+
+// atomicWriteFile writes data to a temp file in path's directory and renames
+// it into place, so a reader never observes a partially written entry and
+// concurrent writers of the same key can't corrupt each other's output.
+func atomicWriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck,gosec
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// marshalProgram serializes pgm using goja's binary program format so it can
+// be stored on disk and reloaded without re-running the parser.
+func marshalProgram(pgm *goja.Program) ([]byte, error) {
+	return pgm.MarshalBinary() //nolint:wrapcheck
+}
+
+// unmarshalProgram is the inverse of marshalProgram.
+func unmarshalProgram(data []byte) (*goja.Program, error) {
+	pgm := new(goja.Program)
+	if err := pgm.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return pgm, nil
+}
@@ -0,0 +1,202 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.k6.io/k6/lib"
+)
+
+func TestHashKeyDistinguishesInputs(t *testing.T) {
+	t.Parallel()
+
+	base := hashKey("1+1", "script.js", 0, struct{ Main bool }{Main: true})
+	require.Equal(t, base, hashKey("1+1", "script.js", 0, struct{ Main bool }{Main: true}), "identical inputs must hash the same")
+	require.NotEqual(t, base, hashKey("1+2", "script.js", 0, struct{ Main bool }{Main: true}), "different source must hash differently")
+	require.NotEqual(t, base, hashKey("1+1", "other.js", 0, struct{ Main bool }{Main: true}), "different filename must hash differently")
+	require.NotEqual(t, base, hashKey("1+1", "script.js", 1, struct{ Main bool }{Main: true}), "different compat mode must hash differently")
+	require.NotEqual(t, base, hashKey("1+1", "script.js", 0, struct{ Main bool }{Main: false}), "different opts (e.g. main) must hash differently")
+}
+
+func TestProgramCacheGetPutRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cache, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+
+	entry := &cacheEntry{Code: "var x = 1;", Program: []byte("fake-program-bytes")}
+	require.NoError(t, cache.put("key1", entry))
+
+	got, ok := cache.get("key1")
+	require.True(t, ok)
+	require.Equal(t, entry.Code, got.Code)
+	require.Equal(t, entry.Program, got.Program)
+
+	// a fresh programCache pointed at the same dir must find it on disk too,
+	// i.e. the in-memory LRU isn't the only thing making this work.
+	cache2, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+	got2, ok := cache2.get("key1")
+	require.True(t, ok)
+	require.Equal(t, entry.Code, got2.Code)
+}
+
+func TestProgramCacheMiss(t *testing.T) {
+	t.Parallel()
+
+	cache, err := newProgramCache(t.TempDir(), "v1.0.0", 10)
+	require.NoError(t, err)
+
+	_, ok := cache.get("does-not-exist")
+	require.False(t, ok)
+}
+
+func TestProgramCacheModeOff(t *testing.T) {
+	t.Parallel()
+
+	cache := &programCache{mode: CacheModeOff}
+	require.NoError(t, cache.put("key1", &cacheEntry{Code: "x"}))
+	_, ok := cache.get("key1")
+	require.False(t, ok, "CacheModeOff must never return a hit")
+}
+
+func TestProgramCacheReadonlyDoesNotPersist(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cache, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+	cache.mode = CacheModeReadonly
+
+	entry := &cacheEntry{Code: "var x = 1;"}
+	require.NoError(t, cache.put("key1", entry))
+
+	// still visible via the in-memory LRU from this same instance...
+	_, ok := cache.get("key1")
+	require.True(t, ok)
+
+	// ...but never written to disk, so a fresh instance over the same dir
+	// must miss.
+	cache2, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+	_, ok = cache2.get("key1")
+	require.False(t, ok)
+}
+
+func TestProgramCacheLRUEviction(t *testing.T) {
+	t.Parallel()
+
+	cache, err := newProgramCache(t.TempDir(), "v1.0.0", 2)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.put("key1", &cacheEntry{Code: "1"}))
+	require.NoError(t, cache.put("key2", &cacheEntry{Code: "2"}))
+	require.NoError(t, cache.put("key3", &cacheEntry{Code: "3"}))
+
+	require.Equal(t, 2, cache.lru.Len())
+	_, ok := cache.vals["key1"]
+	require.False(t, ok, "oldest entry must have been evicted once maxSize was exceeded")
+	_, ok = cache.vals["key3"]
+	require.True(t, ok)
+}
+
+func TestNewProgramCacheInvalidatesOnVersionMismatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cache, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+	require.NoError(t, cache.put("key1", &cacheEntry{Code: "1"}))
+
+	// re-opening with a different k6 version must wipe the stale entry.
+	cache2, err := newProgramCache(dir, "v2.0.0", 10)
+	require.NoError(t, err)
+	_, ok := cache2.get("key1")
+	require.False(t, ok)
+
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, cacheManifestName))
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "v2.0.0")
+}
+
+func TestAtomicWriteFileReplacesExistingContent(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "entry.json")
+
+	require.NoError(t, atomicWriteFile(path, []byte("first")))
+	got, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(got))
+
+	require.NoError(t, atomicWriteFile(path, []byte("second")))
+	got, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(got))
+
+	// no leftover temp files in the target directory.
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestMarshalUnmarshalProgramRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := New(nil)
+	pgm, _, err := c.compileImpl("1 + 1", "inline.js", true, lib.CompatibilityModeBase, nil)
+	require.NoError(t, err)
+
+	data, err := marshalProgram(pgm)
+	require.NoError(t, err)
+
+	restored, err := unmarshalProgram(data)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+}
+
+func TestEntryPathIsSharded(t *testing.T) {
+	t.Parallel()
+
+	cache := &programCache{dir: "/cache"}
+	key := "abcdef0123456789"
+	require.Equal(t, filepath.Join("/cache", "ab", "cd", key+".json"), cache.entryPath(key))
+}
+
+func TestNewProgramCacheCreatesDir(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "nested", "compiler")
+	_, err := newProgramCache(dir, "v1.0.0", 10)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+}
@@ -24,6 +24,8 @@ import (
 	_ "embed" // we need this for embedding Babel
 	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -84,8 +86,6 @@ var (
 	onceBabelCode      sync.Once     // nolint:gochecknoglobals
 	globalBabelCode    *goja.Program // nolint:gochecknoglobals
 	globalBabelCodeErr error         // nolint:gochecknoglobals
-	onceBabel          sync.Once     // nolint:gochecknoglobals
-	globalBabel        *babel        // nolint:gochecknoglobals
 )
 
 const sourceMapURLFromBabel = "k6://internal-should-not-leak/file.map"
@@ -94,6 +94,7 @@ const sourceMapURLFromBabel = "k6://internal-should-not-leak/file.map"
 type Compiler struct {
 	logger  logrus.FieldLogger
 	babel   *babel
+	cache   *programCache
 	Options Options
 }
 
@@ -112,20 +113,19 @@ func (c *Compiler) initializeBabel() error {
 	return err
 }
 
-// Transform the given code into ES5
+// Transform the given code into something goja can compile, using whichever
+// Transformer this Compiler is configured to use (Babel by default).
 func (c *Compiler) Transform(src, filename string, inputSrcMap []byte) (code string, srcMap []byte, err error) {
-	if c.babel == nil {
-		onceBabel.Do(func() {
-			globalBabel, err = newBabel()
-		})
-		c.babel = globalBabel
-	}
+	t, err := c.resolveTransformer()
 	if err != nil {
-		return
+		return "", nil, err
 	}
 
-	code, srcMap, err = c.babel.transformImpl(c.logger, src, filename, c.Options.SourceMapLoader != nil, inputSrcMap)
-	return
+	opts := TransformOptions{
+		SourceMapsEnabled: c.Options.SourceMapLoader != nil,
+		InputSourceMap:    inputSrcMap,
+	}
+	return t.Transform(src, filename, opts)
 }
 
 // Options are options to the compiler
@@ -133,8 +133,91 @@ type Options struct {
 	CompatibilityMode lib.CompatibilityMode
 	SourceMapLoader   func(string) ([]byte, error)
 	Strict            bool
+
+	// CacheDir is the directory backing the persistent compiler cache. If
+	// empty, the cache is looked up under the OS cache dir (e.g.
+	// $XDG_CACHE_HOME/k6/compiler) the first time it's needed.
+	CacheDir string
+	// CacheMode controls whether the persistent cache is consulted/populated
+	// at all. Defaults to CacheModeOn; can be overridden with the
+	// K6_COMPILER_CACHE env var ("on", "off" or "readonly").
+	CacheMode CacheMode
+	// K6Version is embedded in the cache's manifest so entries are
+	// invalidated when k6 itself is upgraded.
+	K6Version string
+
+	// Transformer, if set, overrides TransformerKind and is used as-is. This
+	// is the escape hatch for a caller-provided Transformer (e.g. in tests).
+	Transformer Transformer
+	// TransformerKind selects a built-in Transformer when Transformer is
+	// nil. Defaults to TransformerBabel; can be overridden with the
+	// K6_COMPILER_TRANSFORMER env var ("babel", "native" or "typescript").
+	TransformerKind TransformerKind
+}
+
+// defaultCacheDir returns $XDG_CACHE_HOME/k6/compiler (or the platform
+// equivalent returned by os.UserCacheDir).
+func defaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "k6", "compiler"), nil
+}
+
+// cacheModeFromEnv lets K6_COMPILER_CACHE override Options.CacheMode without
+// every caller having to thread the env through explicitly.
+func cacheModeFromEnv(fallback CacheMode) CacheMode {
+	switch os.Getenv("K6_COMPILER_CACHE") {
+	case "off":
+		return CacheModeOff
+	case "readonly":
+		return CacheModeReadonly
+	case "on":
+		return CacheModeOn
+	default:
+		return fallback
+	}
+}
+
+// initializeCache lazily prepares c.cache the first time it's needed,
+// resolving the cache directory and mode from Options and the environment.
+func (c *Compiler) initializeCache() error {
+	if c.cache != nil {
+		return nil
+	}
+	mode := cacheModeFromEnv(c.Options.CacheMode)
+	if mode == CacheModeOff {
+		c.cache = &programCache{mode: CacheModeOff}
+		return nil
+	}
+
+	dir := c.Options.CacheDir
+	if dir == "" {
+		var err error
+		dir, err = defaultCacheDir()
+		if err != nil {
+			// no usable cache dir (e.g. $HOME unset) - disable the cache
+			// rather than fail the whole compile.
+			c.logger.WithError(err).Debug("Couldn't resolve compiler cache dir, disabling cache")
+			c.cache = &programCache{mode: CacheModeOff}
+			return nil
+		}
+	}
+
+	cache, err := newProgramCache(dir, c.Options.K6Version, defaultCacheMaxEntries)
+	if err != nil {
+		return err
+	}
+	cache.mode = mode
+	c.cache = cache
+	return nil
 }
 
+// defaultCacheMaxEntries caps how many compiled programs are kept in the
+// in-memory LRU in front of the on-disk cache.
+const defaultCacheMaxEntries = 200
+
 // compilationState is helper struct to keep the state of a compilation
 type compilationState struct {
 	// set when we couldn't load external source map so we can try parsing without loading it
@@ -148,7 +231,53 @@ type compilationState struct {
 
 // Compile the program in the given CompatibilityMode, wrapping it between pre and post code
 func (c *Compiler) Compile(src, filename string, main bool) (*goja.Program, string, error) {
-	return c.compileImpl(src, filename, main, c.Options.CompatibilityMode, nil)
+	if err := c.initializeCache(); err != nil {
+		// a broken cache shouldn't prevent the script from running, just
+		// means we fall back to compiling it from scratch every time.
+		c.logger.WithError(err).Warn("Couldn't initialize compiler cache, continuing without it")
+		c.cache = &programCache{mode: CacheModeOff}
+	}
+
+	// only the parts of Options that affect the compiled output go into the
+	// key; SourceMapLoader/Transformer are closures/interfaces and would
+	// make the hash (and thus the cache) unstable across process restarts.
+	// main has to be included too: compileImpl wraps non-main code in
+	// "(function(module, exports){...})", so the same src/filename/options
+	// compiled once as an entry script and once as a required module would
+	// otherwise collide on the same persistent, cross-run cache key and one
+	// would get back the other's (un)wrapped goja.Program.
+	cacheableOpts := struct {
+		Strict          bool
+		HasSourceMaps   bool
+		TransformerKind TransformerKind
+		Main            bool
+	}{
+		Strict:          c.Options.Strict,
+		HasSourceMaps:   c.Options.SourceMapLoader != nil,
+		TransformerKind: transformerKindFromEnv(c.Options.TransformerKind),
+		Main:            main,
+	}
+	key := hashKey(src, filename, int(c.Options.CompatibilityMode), cacheableOpts)
+	if entry, ok := c.cache.get(key); ok {
+		pgm, err := unmarshalProgram(entry.Program)
+		if err == nil {
+			return pgm, entry.Code, nil
+		}
+		c.logger.WithError(err).Debug("Couldn't deserialize cached goja.Program, recompiling")
+	}
+
+	pgm, code, err := c.compileImpl(src, filename, main, c.Options.CompatibilityMode, nil)
+	if err != nil || pgm == nil {
+		return pgm, code, err
+	}
+
+	if raw, merr := marshalProgram(pgm); merr == nil {
+		_ = c.cache.put(key, &cacheEntry{Code: code, Program: raw})
+	} else {
+		c.logger.WithError(merr).Debug("Couldn't serialize goja.Program for the compiler cache")
+	}
+
+	return pgm, code, nil
 }
 
 // sourceMapLoader is to be used with goja's WithSourceMapLoader
@@ -240,37 +369,124 @@ func newBabel() (*babel, error) {
 }
 
 // increaseMappingsByOne increases the lines in the sourcemap by line so that it fixes the case where we need to wrap a
-// required file in a function to support/emulate commonjs
+// required file in a function to support/emulate commonjs.
+//
+// Bundlers like webpack, esbuild and rollup can produce the indexed/sections
+// form of the source map spec (https://sourcemaps.info/spec.html#h.535es3xeprgt)
+// instead of a single flat "mappings" string, so that case is handled too:
+// every section's offset.line is bumped by one (its column is untouched,
+// since the extra line is prepended whole), recursing in case a section's
+// own "map" is itself sectioned.
 func (c *compilationState) increaseMappingsByOne(sourceMap []byte) ([]byte, error) {
-	var err error
 	m := make(map[string]interface{})
-	if err = json.Unmarshal(sourceMap, &m); err != nil {
+	if err := json.Unmarshal(sourceMap, &m); err != nil {
+		return nil, err
+	}
+
+	// the "sections" key is what the spec actually uses to distinguish the
+	// indexed form from the flat one - real bundler output isn't required
+	// to put "sections" right after "version" (e.g. a "file" or
+	// "sourceRoot" key can come first), so a byte-prefix sniff can only
+	// ever be used as a non-gating optimization hint, never the sole check.
+	sections, ok := m["sections"]
+	if !ok {
+		return c.increaseFlatMappingsByOne(sourceMap)
+	}
+	sectionList, ok := sections.([]interface{})
+	if !ok {
+		c.couldntLoadSourceMap = true
+		return nil, errors.New(`"sections" in sourcemap is not an array`)
+	}
+
+	for i, s := range sectionList {
+		section, ok := s.(map[string]interface{})
+		if !ok {
+			c.couldntLoadSourceMap = true
+			return nil, errors.New(`a sourcemap section is not an object`)
+		}
+		if err := increaseSectionOffsetByOne(section); err != nil {
+			c.couldntLoadSourceMap = true
+			return nil, err
+		}
+		sectionList[i] = section
+	}
+	m["sections"] = sectionList
+
+	return json.Marshal(m)
+}
+
+// increaseFlatMappingsByOne is the original, non-sectioned handling: it
+// prepends a ";" to the "mappings" string so every existing line's mappings
+// shift down by one line.
+func (c *compilationState) increaseFlatMappingsByOne(sourceMap []byte) ([]byte, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(sourceMap, &m); err != nil {
 		return nil, err
 	}
 	mappings, ok := m["mappings"]
 	if !ok {
-		// no mappings, no idea what this will do, but just return it as technically we can have sourcemap with sections
-		// TODO implement incrementing of `offset` in the sections? to support that case as well
-		// see https://sourcemaps.info/spec.html#h.n05z8dfyl3yh
-		//
-		// TODO (kind of alternatively) drop the newline in the "commonjs" wrapping and have only the first line wrong
-		// and drop this whole function
+		// no mappings, nothing to shift - return as-is.
 		return sourceMap, nil
 	}
-	if str, ok := mappings.(string); ok {
-		// ';' is the separator between lines so just adding 1 will make all mappings be for the line after which they were
-		// originally
-		m["mappings"] = ";" + str
-	} else {
+	str, ok := mappings.(string)
+	if !ok {
 		// we have mappings but it's not a string - this is some kind of error
 		// we still won't abort the test but just not load the sourcemap
 		c.couldntLoadSourceMap = true
 		return nil, errors.New(`missing "mappings" in sourcemap`)
 	}
+	// ';' is the separator between lines so just adding 1 will make all mappings be for the line after which they were
+	// originally
+	m["mappings"] = ";" + str
 
 	return json.Marshal(m)
 }
 
+// increaseSectionOffsetByOne bumps a single section's offset.line by one in
+// place, recursing into a nested "map" field if that section's map is
+// itself in the sections form, and otherwise applying the regular flat
+// "mappings" shift - which also preserves any "sourcesContent"/"sourceRoot"
+// fields and any other keys the unmarshal/marshal round trip already keeps
+// untouched.
+func increaseSectionOffsetByOne(section map[string]interface{}) error {
+	offset, ok := section["offset"].(map[string]interface{})
+	if !ok {
+		return errors.New(`sourcemap section is missing its "offset"`)
+	}
+	line, ok := offset["line"].(float64)
+	if !ok {
+		return errors.New(`sourcemap section "offset.line" is not a number`)
+	}
+	offset["line"] = line + 1
+	section["offset"] = offset
+
+	raw, ok := section["map"]
+	if !ok {
+		return nil
+	}
+
+	rawMap, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	// increaseMappingsByOne itself decides (by checking for a "sections"
+	// key) whether this nested map is sectioned or flat, so it's safe to
+	// always call it here rather than re-deciding based on a prefix sniff.
+	state := compilationState{}
+	fixed, err := state.increaseMappingsByOne(rawMap)
+	if err != nil {
+		return err
+	}
+
+	var nested interface{}
+	if err := json.Unmarshal(fixed, &nested); err != nil {
+		return err
+	}
+	section["map"] = nested
+	return nil
+}
+
 // transformImpl the given code into ES5, while synchronizing to ensure only a single
 // bundle instance / Goja VM is in use at a time.
 func (b *babel) transformImpl(
@@ -0,0 +1,165 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncreaseFlatMappingsByOne(t *testing.T) {
+	t.Parallel()
+
+	state := &compilationState{}
+	in := []byte(`{"version":3,"file":"out.js","mappings":"AAAA;AACA","sourcesContent":["x"]}`)
+
+	out, err := state.increaseMappingsByOne(in)
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &m))
+	require.Equal(t, ";AAAA;AACA", m["mappings"])
+	// unrelated fields must survive the round trip untouched.
+	require.Equal(t, "out.js", m["file"])
+	require.Equal(t, []interface{}{"x"}, m["sourcesContent"])
+}
+
+func TestIncreaseMappingsByOneNoMappings(t *testing.T) {
+	t.Parallel()
+
+	state := &compilationState{}
+	in := []byte(`{"version":3,"file":"out.js"}`)
+
+	out, err := state.increaseMappingsByOne(in)
+	require.NoError(t, err)
+	require.JSONEq(t, string(in), string(out))
+}
+
+// webpackStyleSections mirrors what webpack/esbuild/rollup actually emit for
+// an indexed source map: "sections" does NOT immediately follow "version" -
+// "file" comes first. A byte-prefix sniff for `{"version":3,"sections"`
+// would miss this, which is exactly the bug this test guards against.
+const webpackStyleSections = `{
+	"version": 3,
+	"file": "bundle.js",
+	"sections": [
+		{
+			"offset": {"line": 0, "column": 0},
+			"map": {
+				"version": 3,
+				"sources": ["a.js"],
+				"mappings": "AAAA",
+				"sourcesContent": ["console.log(1)"]
+			}
+		},
+		{
+			"offset": {"line": 5, "column": 10},
+			"map": {
+				"version": 3,
+				"sources": ["b.js"],
+				"mappings": "ACAA",
+				"sourcesContent": ["console.log(2)"]
+			}
+		}
+	]
+}`
+
+func TestIncreaseMappingsByOneSections(t *testing.T) {
+	t.Parallel()
+
+	state := &compilationState{}
+	out, err := state.increaseMappingsByOne([]byte(webpackStyleSections))
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &m))
+	require.Equal(t, "bundle.js", m["file"], "unknown top-level fields must be preserved")
+
+	sections, ok := m["sections"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, sections, 2)
+
+	first := sections[0].(map[string]interface{})
+	firstOffset := first["offset"].(map[string]interface{})
+	require.Equal(t, float64(1), firstOffset["line"])
+	require.Equal(t, float64(0), firstOffset["column"], "column must be left untouched")
+
+	second := sections[1].(map[string]interface{})
+	secondOffset := second["offset"].(map[string]interface{})
+	require.Equal(t, float64(6), secondOffset["line"])
+	require.Equal(t, float64(10), secondOffset["column"])
+
+	firstMap := first["map"].(map[string]interface{})
+	require.Equal(t, ";AAAA", firstMap["mappings"], "a flat nested map gets the regular ';' shift on top of its offset bump")
+	require.Equal(t, []interface{}{"console.log(1)"}, firstMap["sourcesContent"])
+}
+
+// nestedSections is a pathological-but-legal indexed map whose own section
+// recurses into another indexed map, as the spec allows.
+const nestedSections = `{
+	"version": 3,
+	"sections": [
+		{
+			"offset": {"line": 0, "column": 0},
+			"map": {
+				"version": 3,
+				"sections": [
+					{
+						"offset": {"line": 2, "column": 0},
+						"map": {"version": 3, "mappings": "AAAA"}
+					}
+				]
+			}
+		}
+	]
+}`
+
+func TestIncreaseMappingsByOneNestedSections(t *testing.T) {
+	t.Parallel()
+
+	state := &compilationState{}
+	out, err := state.increaseMappingsByOne([]byte(nestedSections))
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &m))
+
+	outer := m["sections"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, float64(1), outer["offset"].(map[string]interface{})["line"])
+
+	innerMap := outer["map"].(map[string]interface{})
+	inner := innerMap["sections"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, float64(3), inner["offset"].(map[string]interface{})["line"], "nested sections must be bumped too")
+
+	innerLeaf := inner["map"].(map[string]interface{})
+	require.Equal(t, ";AAAA", innerLeaf["mappings"])
+}
+
+func TestIncreaseMappingsByOneMalformedSections(t *testing.T) {
+	t.Parallel()
+
+	state := &compilationState{}
+	_, err := state.increaseMappingsByOne([]byte(`{"version":3,"sections":"not-an-array"}`))
+	require.Error(t, err)
+	require.True(t, state.couldntLoadSourceMap)
+}
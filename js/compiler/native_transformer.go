@@ -0,0 +1,477 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja/parser"
+	"github.com/sirupsen/logrus"
+)
+
+// nativeTransformer is a Transformer that doesn't shell out to a
+// Babel-in-goja VM at all, and holds no shared state, so - unlike
+// babelTransformer - it never needs to serialize callers behind a mutex.
+//
+// Since goja's own parser already accepts almost everything es2015/es2017
+// throws at it (see the long list of commented-out plugins in
+// DefaultOpts), most scripts need no transform at all and pass straight
+// through. The one ES2016+ addition it does lower for real is the
+// exponentiation operator (`a ** b` -> `Math.pow(a, b)`), directly on the
+// token stream rather than a full AST, since that rewrite only needs to
+// find operand boundaries, not reshape control flow.
+//
+// async/await and class fields are NOT lowered yet: turning `await` into a
+// generator-based state machine, or desugaring class fields into
+// constructor assignments, both need a real rewrite of the surrounding
+// function/class structure that a token-level pass can't do safely. Scripts
+// using them get a clear, actionable error pointing at TransformerBabel
+// instead of silently broken output, rather than pretending support that
+// isn't there.
+type nativeTransformer struct {
+	logger logrus.FieldLogger
+}
+
+func newNativeTransformer(logger logrus.FieldLogger) *nativeTransformer {
+	return &nativeTransformer{logger: logger}
+}
+
+// errUnsupportedByNativeTransformerFmt is used (formatted with which
+// construct triggered it) when the script needs a rewrite nativeTransformer
+// doesn't implement yet.
+const errUnsupportedByNativeTransformerFmt = "%s is not yet supported by the native compiler transformer (K6_COMPILER_TRANSFORMER=native); " +
+	"use TransformerBabel (the default) for this script"
+
+func (t *nativeTransformer) Transform(src, filename string, opts TransformOptions) (string, []byte, error) {
+	code := lowerExponentiation(src)
+
+	if _, err := parser.ParseFile(nil, filename, code, 0, parser.WithDisableSourceMaps); err == nil {
+		return code, nil, nil
+	}
+
+	if construct := detectUnsupportedConstruct(code); construct != "" {
+		return "", nil, fmt.Errorf(errUnsupportedByNativeTransformerFmt, construct) //nolint:goerr113
+	}
+
+	// not one of the constructs we know about - let the real parse error
+	// from the caller's subsequent parse attempt surface instead of masking
+	// it here.
+	return code, nil, nil
+}
+
+// detectUnsupportedConstruct does a best-effort, string-literal/comment
+// aware scan for the handful of syntax forms nativeTransformer knows it
+// can't lower. It intentionally errs on the side of false negatives: a miss
+// here just means the generic parser error is returned instead.
+func detectUnsupportedConstruct(src string) string {
+	tokens := nonLiteralTokens(src)
+	switch {
+	case containsToken(tokens, "**"):
+		// either lowerExponentiation couldn't find safe operand boundaries
+		// for this occurrence (e.g. it's inside a `**=` compound
+		// assignment, which isn't lowered), or it failed outright.
+		return "this use of the exponentiation operator (**)"
+	case containsToken(tokens, "async"):
+		return "async/await"
+	case containsToken(tokens, "class") && containsToken(tokens, "="):
+		// can't tell class fields from a class containing an ordinary
+		// assignment without a real parse; this is a coarse heuristic.
+		return "class fields"
+	default:
+		return ""
+	}
+}
+
+// nonLiteralTokens returns src with all string/template literals and
+// comments blanked out, so substring/keyword checks don't trigger on code
+// that merely mentions "async" inside a string.
+func nonLiteralTokens(src string) string {
+	runes := []rune(src)
+	out := make([]rune, len(runes))
+	copy(out, runes)
+
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\'', '"', '`':
+			end := skipStringLiteral(runes, i)
+			for j := i; j < end; j++ {
+				out[j] = ' '
+			}
+			i = end - 1
+		case '/':
+			if i+1 < len(runes) && runes[i+1] == '/' {
+				end := skipLineComment(runes, i)
+				for j := i; j < end; j++ {
+					out[j] = ' '
+				}
+				i = end - 1
+			} else if i+1 < len(runes) && runes[i+1] == '*' {
+				end := skipBlockComment(runes, i)
+				for j := i; j < end; j++ {
+					out[j] = ' '
+				}
+				i = end - 1
+			}
+		}
+	}
+
+	return string(out)
+}
+
+func containsToken(src, token string) bool {
+	for i := 0; i+len(token) <= len(src); i++ {
+		if src[i:i+len(token)] != token {
+			continue
+		}
+		before := byte(' ')
+		if i > 0 {
+			before = src[i-1]
+		}
+		after := byte(' ')
+		if i+len(token) < len(src) {
+			after = src[i+len(token)]
+		}
+		if !isIdentByte(before) && !isIdentByte(after) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '$' ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+func skipStringLiteral(runes []rune, start int) int {
+	quote := runes[start]
+	i := start + 1
+	for i < len(runes) {
+		if runes[i] == '\\' {
+			i += 2
+			continue
+		}
+		if runes[i] == quote {
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+func skipLineComment(runes []rune, start int) int {
+	i := start
+	for i < len(runes) && runes[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+func skipBlockComment(runes []rune, start int) int {
+	i := start + 2
+	for i+1 < len(runes) {
+		if runes[i] == '*' && runes[i+1] == '/' {
+			return i + 2
+		}
+		i++
+	}
+	return len(runes)
+}
+
+// exponentTokenKind classifies a token for the purposes of finding the
+// operand boundaries of an exponentiation expression.
+type exponentTokenKind int
+
+const (
+	exponentTokOther exponentTokenKind = iota
+	exponentTokIdent
+	exponentTokNumber
+	exponentTokString
+	exponentTokPunct
+)
+
+type exponentToken struct {
+	kind       exponentTokenKind
+	text       string
+	start, end int
+}
+
+// tokenizeForExponent does a lightweight JS tokenization good enough to
+// find `**`'s operands: it knows about identifiers, numbers, string/
+// template literals and comments, and otherwise emits single-character
+// punctuators. It does NOT disambiguate regex literals from division,
+// since that needs a real parser's notion of expression-vs-statement
+// context; a regex literal containing unbalanced brackets can therefore
+// confuse the operand search below, same limitation as the TypeScript
+// regexes in typescript_transformer.go.
+func tokenizeForExponent(src string) []exponentToken {
+	var toks []exponentToken
+	runes := []rune(src)
+	n := len(runes)
+
+	byteOffset := make([]int, n+1)
+	offset := 0
+	for i, r := range runes {
+		byteOffset[i] = offset
+		offset += len(string(r))
+	}
+	byteOffset[n] = offset
+
+	i := 0
+	for i < n {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '/' && i+1 < n && runes[i+1] == '/':
+			i = skipLineComment(runes, i)
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			i = skipBlockComment(runes, i)
+		case r == '\'' || r == '"' || r == '`':
+			end := skipStringLiteral(runes, i)
+			toks = append(toks, exponentToken{kind: exponentTokString, text: string(runes[i:end]), start: byteOffset[i], end: byteOffset[end]})
+			i = end
+		case isIdentByte(byte(r)) && !(r >= '0' && r <= '9'):
+			end := i + 1
+			for end < n && isIdentRune(runes[end]) {
+				end++
+			}
+			toks = append(toks, exponentToken{kind: exponentTokIdent, text: string(runes[i:end]), start: byteOffset[i], end: byteOffset[end]})
+			i = end
+		case r >= '0' && r <= '9':
+			end := i + 1
+			for end < n && isNumberRune(runes[end]) {
+				end++
+			}
+			toks = append(toks, exponentToken{kind: exponentTokNumber, text: string(runes[i:end]), start: byteOffset[i], end: byteOffset[end]})
+			i = end
+		case r == '*' && i+1 < n && runes[i+1] == '*' && i+2 < n && runes[i+2] == '=':
+			toks = append(toks, exponentToken{kind: exponentTokPunct, text: "**=", start: byteOffset[i], end: byteOffset[i+3]})
+			i += 3
+		case r == '*' && i+1 < n && runes[i+1] == '*':
+			toks = append(toks, exponentToken{kind: exponentTokPunct, text: "**", start: byteOffset[i], end: byteOffset[i+2]})
+			i += 2
+		default:
+			toks = append(toks, exponentToken{kind: exponentTokPunct, text: string(r), start: byteOffset[i], end: byteOffset[i+1]})
+			i++
+		}
+	}
+	return toks
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func isNumberRune(r rune) bool {
+	return (r >= '0' && r <= '9') || r == '.' || r == 'x' || r == 'X' || r == 'e' || r == 'E' || r == '_' ||
+		(r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// lowerExponentiation rewrites every `a ** b` in src into `Math.pow(a, b)`,
+// working right-to-left so chained/right-associative uses like
+// `2 ** 3 ** 4` (== `2 ** (3 ** 4)`) come out correctly: the rightmost `**`
+// is rewritten first, so by the time an outer `**` is processed its right
+// operand is already the (now primary-expression) `Math.pow(...)` call.
+//
+// `**=` is left untouched - rewriting it correctly would need to evaluate
+// its left-hand side only once, which isn't safe to do with a textual
+// substitution when that left-hand side has side effects (e.g. a computed
+// member access). Scripts using it should keep using TransformerBabel.
+//
+// Any occurrence whose operand boundaries can't be determined confidently
+// (mismatched brackets, no operand found, ...) is left as-is; it'll be
+// reported by detectUnsupportedConstruct once the subsequent goja parse
+// fails on it.
+func lowerExponentiation(src string) string {
+	if !strings.Contains(src, "**") {
+		return src
+	}
+
+	const maxRewrites = 1000 // guards against an infinite loop from an unexpected token-stream bug
+	for n := 0; n < maxRewrites; n++ {
+		toks := tokenizeForExponent(src)
+		opIdx := -1
+		for i, t := range toks {
+			if t.kind == exponentTokPunct && t.text == "**" {
+				opIdx = i // keep scanning: last match wins, i.e. rightmost occurrence
+			}
+		}
+		if opIdx < 0 {
+			break
+		}
+
+		leftStart, leftOK := findExponentLeftOperandStart(toks, opIdx)
+		rightEnd, rightOK := findExponentRightOperandEnd(toks, opIdx)
+		if !leftOK || !rightOK {
+			// can't safely rewrite this occurrence (or any other - they're
+			// all still in the token stream); stop and let it surface as a
+			// parse error/unsupported-construct message instead.
+			break
+		}
+
+		left := strings.TrimSpace(src[toks[leftStart].start:toks[opIdx].start])
+		right := strings.TrimSpace(src[toks[opIdx+1].start:toks[rightEnd].end])
+		rewritten := src[:toks[leftStart].start] + "Math.pow(" + left + ", " + right + ")" + src[toks[rightEnd].end:]
+		if rewritten == src {
+			break
+		}
+		src = rewritten
+	}
+
+	return src
+}
+
+// findExponentLeftOperandStart scans backward from the `**` token at opIdx
+// to find where its left operand begins: the maximal postfix-expression
+// chain of identifiers/numbers/strings, `.member` accesses and balanced
+// `(...)`/`[...]` groups immediately preceding it.
+func findExponentLeftOperandStart(toks []exponentToken, opIdx int) (int, bool) {
+	start := opIdx
+	var stack []byte // expected closing bracket for each unmatched ")"/"]" seen so far
+
+	for i := opIdx - 1; i >= 0; i-- {
+		t := toks[i]
+
+		if len(stack) > 0 {
+			switch t.text {
+			case ")":
+				stack = append(stack, ')')
+			case "]":
+				stack = append(stack, ']')
+			case "(":
+				if stack[len(stack)-1] != ')' {
+					return 0, false
+				}
+				stack = stack[:len(stack)-1]
+			case "[":
+				if stack[len(stack)-1] != ']' {
+					return 0, false
+				}
+				stack = stack[:len(stack)-1]
+			}
+			start = i
+			continue
+		}
+
+		switch {
+		case t.kind == exponentTokIdent && (t.text == "return" || t.text == "throw" || t.text == "case" ||
+			t.text == "yield" || t.text == "in" || t.text == "of" || t.text == "instanceof" ||
+			t.text == "else" || t.text == "do"):
+			// a keyword that introduces or joins expressions isn't part of
+			// the operand - operand ends here.
+			i = -1
+		case t.kind == exponentTokIdent || t.kind == exponentTokNumber || t.kind == exponentTokString:
+			start = i
+		case t.kind == exponentTokPunct && t.text == ".":
+			start = i
+		case t.kind == exponentTokPunct && t.text == ")":
+			stack = append(stack, ')')
+			start = i
+		case t.kind == exponentTokPunct && t.text == "]":
+			stack = append(stack, ']')
+			start = i
+		default:
+			// an operator, comma, keyword, brace, etc. - operand ends here.
+			i = -1
+		}
+		if i == -1 {
+			break
+		}
+	}
+
+	if len(stack) != 0 || start == opIdx {
+		return 0, false
+	}
+	return start, true
+}
+
+// findExponentRightOperandEnd is the mirror of
+// findExponentLeftOperandStart, scanning forward from the `**` token,
+// additionally allowing a single leading unary operator (`2 ** -2` is
+// valid JS, unlike unary on the left of `**`).
+func findExponentRightOperandEnd(toks []exponentToken, opIdx int) (int, bool) {
+	i := opIdx + 1
+	if i >= len(toks) {
+		return 0, false
+	}
+
+	if t := toks[i]; t.kind == exponentTokPunct && (t.text == "-" || t.text == "+" || t.text == "~" || t.text == "!") {
+		i++
+	} else if t.kind == exponentTokIdent && (t.text == "typeof" || t.text == "void" || t.text == "delete" || t.text == "await") {
+		i++
+	}
+	if i >= len(toks) {
+		return 0, false
+	}
+
+	end := -1
+	var stack []byte
+
+	for ; i < len(toks); i++ {
+		t := toks[i]
+
+		if len(stack) > 0 {
+			switch t.text {
+			case "(":
+				stack = append(stack, ')')
+			case "[":
+				stack = append(stack, ']')
+			case ")":
+				if stack[len(stack)-1] != ')' {
+					return 0, false
+				}
+				stack = stack[:len(stack)-1]
+			case "]":
+				if stack[len(stack)-1] != ']' {
+					return 0, false
+				}
+				stack = stack[:len(stack)-1]
+			}
+			end = i
+			continue
+		}
+
+		switch {
+		case t.kind == exponentTokIdent || t.kind == exponentTokNumber || t.kind == exponentTokString:
+			end = i
+		case t.kind == exponentTokPunct && t.text == ".":
+			end = i
+		case t.kind == exponentTokPunct && t.text == "(":
+			stack = append(stack, ')')
+			end = i
+		case t.kind == exponentTokPunct && t.text == "[":
+			stack = append(stack, ']')
+			end = i
+		default:
+			i = len(toks) // break outer loop
+		}
+		if i == len(toks) {
+			break
+		}
+	}
+
+	if len(stack) != 0 || end == -1 {
+		return 0, false
+	}
+	return end, true
+}
@@ -0,0 +1,112 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLowerExponentiationSimple(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "Math.pow(2, 3)", lowerExponentiation("2 ** 3"))
+}
+
+func TestLowerExponentiationRightAssociative(t *testing.T) {
+	t.Parallel()
+	// 2 ** 3 ** 4 == 2 ** (3 ** 4), so the innermost pow call must be the
+	// exponent of the outer one, not the other way around.
+	require.Equal(t, "Math.pow(2, Math.pow(3, 4))", lowerExponentiation("2 ** 3 ** 4"))
+}
+
+func TestLowerExponentiationMemberAndCallChains(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "Math.pow(foo.bar(1, 2)[0], n)", lowerExponentiation("foo.bar(1, 2)[0] ** n"))
+}
+
+func TestLowerExponentiationParenthesizedOperand(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "Math.pow((a + b), 2)", lowerExponentiation("(a + b) ** 2"))
+}
+
+func TestLowerExponentiationUnaryRightOperand(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "Math.pow(2, -2)", lowerExponentiation("2 ** -2"))
+}
+
+func TestLowerExponentiationLeavesCompoundAssignmentAlone(t *testing.T) {
+	t.Parallel()
+	// x **= y is out of scope (see lowerExponentiation's doc comment); it
+	// must be left untouched rather than mangled.
+	src := "x **= y;"
+	require.Equal(t, src, lowerExponentiation(src))
+}
+
+func TestLowerExponentiationNoOccurrence(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "1 + 1", lowerExponentiation("1 + 1"))
+}
+
+func TestLowerExponentiationMultipleStatements(t *testing.T) {
+	t.Parallel()
+	src := "var a = x ** 2;\nvar b = y ** 3;"
+	want := "var a = Math.pow(x, 2);\nvar b = Math.pow(y, 3);"
+	require.Equal(t, want, lowerExponentiation(src))
+}
+
+func TestNativeTransformerLowersExponentiation(t *testing.T) {
+	t.Parallel()
+
+	nt := newNativeTransformer(nil)
+	code, srcMap, err := nt.Transform("var x = 2 ** 8;", "script.js", TransformOptions{})
+	require.NoError(t, err)
+	require.Nil(t, srcMap)
+	require.Contains(t, code, "Math.pow(2, 8)")
+}
+
+func TestNativeTransformerPassesThroughPlainES5(t *testing.T) {
+	t.Parallel()
+
+	nt := newNativeTransformer(nil)
+	src := "function add(a, b) { return a + b; }"
+	code, _, err := nt.Transform(src, "script.js", TransformOptions{})
+	require.NoError(t, err)
+	require.Equal(t, src, code)
+}
+
+func TestNativeTransformerRejectsAsyncAwait(t *testing.T) {
+	t.Parallel()
+
+	nt := newNativeTransformer(nil)
+	_, _, err := nt.Transform("async function f() { await g(); }", "script.js", TransformOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "async/await")
+	require.Contains(t, err.Error(), "TransformerBabel")
+}
+
+func TestDetectUnsupportedConstructIgnoresStringsAndComments(t *testing.T) {
+	t.Parallel()
+	// "async" only appears inside a string literal and a comment, so this
+	// must not be flagged as using async/await.
+	src := "var s = 'async'; // async too\nvar x = 1;"
+	require.Equal(t, "", detectUnsupportedConstruct(src))
+}
@@ -0,0 +1,98 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import "os"
+
+// TransformOptions carries the bits of a Transform call that aren't the
+// source itself - whether source maps should be produced and, if so, the
+// input source map to merge with.
+type TransformOptions struct {
+	SourceMapsEnabled bool
+	InputSourceMap    []byte
+}
+
+// Transformer lowers a single source file into code goja can compile
+// directly (ES5.1, or whatever subset of later syntax goja itself accepts).
+// Compiler depends on this interface rather than on Babel directly, so
+// alternative implementations - a native Go transformer, TypeScript
+// stripping, or a test double - can be swapped in through Options.
+type Transformer interface {
+	Transform(src, filename string, opts TransformOptions) (code string, srcMap []byte, err error)
+}
+
+// TransformerKind selects one of the built-in Transformer implementations.
+//
+//go:generate enumer -type=TransformerKind -trimprefix TransformerKind -transform snake -output transformer_kind_gen.go
+type TransformerKind int
+
+const (
+	// TransformerBabel runs the existing Babel-in-goja pipeline. It's the
+	// default and the most complete, at the cost of a per-Compiler mutex
+	// serializing every transform that goes through that Compiler's Babel VM.
+	TransformerBabel TransformerKind = iota
+	// TransformerNative lowers the exponentiation operator on a token
+	// stream, without a JS round trip and without building an AST. It does
+	// not lower async/await or class fields; scripts using them get an
+	// error. See nativeTransformer.
+	TransformerNative
+	// TransformerTypeScript strips TypeScript type syntax (no type
+	// checking) and then runs the result through the native transformer.
+	TransformerTypeScript
+)
+
+// transformerKindFromEnv lets K6_COMPILER_TRANSFORMER override
+// Options.TransformerKind without every caller having to thread the env
+// through explicitly, mirroring cacheModeFromEnv.
+func transformerKindFromEnv(fallback TransformerKind) TransformerKind {
+	switch os.Getenv("K6_COMPILER_TRANSFORMER") {
+	case "native":
+		return TransformerNative
+	case "typescript":
+		return TransformerTypeScript
+	case "babel":
+		return TransformerBabel
+	default:
+		return fallback
+	}
+}
+
+// resolveTransformer returns the Transformer to use for this Compiler,
+// honoring an explicitly injected Options.Transformer first, then falling
+// back to the built-in implementation selected by Options.TransformerKind /
+// K6_COMPILER_TRANSFORMER.
+func (c *Compiler) resolveTransformer() (Transformer, error) {
+	if c.Options.Transformer != nil {
+		return c.Options.Transformer, nil
+	}
+
+	switch transformerKindFromEnv(c.Options.TransformerKind) {
+	case TransformerNative:
+		return newNativeTransformer(c.logger), nil
+	case TransformerTypeScript:
+		return newTypeScriptTransformer(c.logger), nil
+	default:
+		if err := c.initializeBabel(); err != nil {
+			return nil, err
+		}
+		return &babelTransformer{b: c.babel, logger: c.logger}, nil
+	}
+}
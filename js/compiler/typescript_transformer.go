@@ -0,0 +1,215 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// typeScriptTransformer strips TypeScript's type-only syntax so scripts can
+// `import x from './x.ts'`. It does not type-check - like Babel's own
+// typescript preset in "isolatedModules" mode, it only ever deletes syntax,
+// never interprets it, so a script with type errors still runs the same as
+// it would with `tsc --noEmit` skipped. The result is handed to
+// nativeTransformer for the usual ES2016+ lowering.
+type typeScriptTransformer struct {
+	logger logrus.FieldLogger
+	native *nativeTransformer
+}
+
+func newTypeScriptTransformer(logger logrus.FieldLogger) *typeScriptTransformer {
+	return &typeScriptTransformer{logger: logger, native: newNativeTransformer(logger)}
+}
+
+// These cover the common cases well enough for straight-line test scripts;
+// they are not a replacement for a real TypeScript parser and will mishandle
+// pathological generic/union types spanning multiple lines.
+//
+// Go's regexp package is RE2-based and doesn't support lookaround, so
+// patterns that need to check (without consuming) a trailing delimiter
+// capture that delimiter instead and re-emit it in the replacement.
+var (
+	tsInterfaceBlockRe = regexp.MustCompile(`(?s)(?:export\s+)?interface\s+\w+(?:<[^{]*?>)?\s*(?:extends\s+[^{]+)?\{.*?\n\}\n?`)
+	tsTypeAliasRe      = regexp.MustCompile(`(?m)^(?:export\s+)?type\s+\w+(?:<[^=]*?>)?\s*=.*?;\s*$\n?`)
+	tsImportTypeRe     = regexp.MustCompile(`(?m)^import\s+type\s+.*?;\s*$\n?`)
+	tsAsCastRe         = regexp.MustCompile(`\s+as\s+[A-Za-z_$][\w.<>\[\],\s]*`)
+	tsNonNullRe        = regexp.MustCompile(`([\w)\]])!([.\s;,)\]]|$)`)
+	tsOptionalParamRe  = regexp.MustCompile(`(\w)\?(\s*:)`)
+
+	// tsImportExportClauseRe matches whole import/re-export clauses,
+	// including the ones that use "as" for plain ES module renaming
+	// (`import { foo as bar } from './m'`, `import * as ns from './m'`,
+	// `export { foo as bar } from './m'`) rather than a TypeScript type
+	// cast. These are masked out before tsAsCastRe runs so it can't mistake
+	// a rename for a cast.
+	tsImportExportClauseRe = regexp.MustCompile(`(?s)import\s+(?:[\w$]+\s*,\s*)?(?:\*\s+as\s+[\w$]+|\{[^}]*\})?\s*from\s*['"][^'"]*['"]\s*;?` +
+		`|import\s*['"][^'"]*['"]\s*;?` +
+		`|export\s*\{[^}]*\}\s*(?:from\s*['"][^'"]*['"])?\s*;?`)
+)
+
+func (t *typeScriptTransformer) Transform(src, filename string, opts TransformOptions) (string, []byte, error) {
+	code := src
+	code = tsImportTypeRe.ReplaceAllString(code, "")
+	code = tsInterfaceBlockRe.ReplaceAllString(code, "")
+	code = tsTypeAliasRe.ReplaceAllString(code, "")
+
+	code, restore := maskImportExportClauses(code)
+	code = tsAsCastRe.ReplaceAllString(code, "")
+	code = restore(code)
+
+	code = tsNonNullRe.ReplaceAllString(code, "$1$2")
+	code = tsOptionalParamRe.ReplaceAllString(code, "$1$2")
+	code = stripParamAndReturnTypes(code)
+
+	return t.native.Transform(code, filename, opts)
+}
+
+// stripParamAndReturnTypes removes TypeScript parameter and return type
+// annotations (`function f(a: string): void {}` -> `function f(a) {}`).
+// A plain regex can't do this safely: `ident: Type` and an object literal's
+// `key: value` are the same shape, and only the enclosing bracket tells
+// them apart. So this reuses nativeTransformer's lightweight tokenizer,
+// which already knows how to skip over strings/template literals/comments
+// without getting confused by brackets or colons inside them, and tracks
+// the stack of enclosing `(`/`{`/`[` to classify each `:`:
+//
+//   - preceded by `)` -> a return type (`): T`), always stripped;
+//   - preceded by an identifier or `]`, with `(` on top of the bracket
+//     stack -> a parameter type, stripped;
+//   - anything else (bracket stack top is `{` or `[`, or empty) -> left
+//     alone, since it's an object/array literal's `key: value`, not a type.
+//
+// Deciding every colon's span up front from the full token list, instead of
+// stripping left-to-right with successive regex passes, also means a
+// stripped parameter type can never eat the `)` a following return type
+// annotation needs to anchor on.
+//
+// Like the rest of this file, this isn't a real parser: a parenthesized
+// type literal used as a parameter type (`a: {b: string}`), or a colon
+// that looks like a return type but is actually a ternary's `(cond) : x`,
+// can still be misread. Those are rare enough in k6 scripts not to block
+// the common cases this fixes.
+func stripParamAndReturnTypes(src string) string {
+	toks := tokenizeForExponent(src)
+
+	type stripSpan struct{ start, end int }
+	var spans []stripSpan
+	var stack []byte
+
+	for i, tok := range toks {
+		if tok.kind != exponentTokPunct {
+			continue
+		}
+		switch tok.text {
+		case "(", "{", "[":
+			stack = append(stack, tok.text[0])
+		case ")", "}", "]":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ":":
+			if i == 0 {
+				continue
+			}
+			prev := toks[i-1]
+			isReturnType := prev.kind == exponentTokPunct && prev.text == ")"
+			isParamType := !isReturnType && len(stack) > 0 && stack[len(stack)-1] == '(' &&
+				(prev.kind == exponentTokIdent || (prev.kind == exponentTokPunct && prev.text == "]"))
+			if isReturnType || isParamType {
+				spans = append(spans, stripSpan{start: tok.start, end: typeAnnotationEnd(toks, i, len(src))})
+			}
+		}
+	}
+
+	if len(spans) == 0 {
+		return src
+	}
+
+	var b strings.Builder
+	cursor := 0
+	for _, sp := range spans {
+		if sp.start < cursor {
+			continue
+		}
+		b.WriteString(src[cursor:sp.start])
+		cursor = sp.end
+	}
+	b.WriteString(src[cursor:])
+	return b.String()
+}
+
+// typeAnnotationEnd returns the byte offset where the type expression
+// starting right after toks[colonIdx] (the `:`) ends, so the caller can
+// strip exactly `[colon, end)`. It tracks its own nesting depth for
+// `<`/`[`/`(` so generics and array types (`Map<string, number>`,
+// `string[]`) don't stop at their internal commas or brackets, and stops
+// at the first `,`, `=`, `;`, `{`, or unmatched `)`/`]`/`>` seen at depth
+// zero - whichever comes first marks the end of the annotation and is not
+// itself consumed.
+func typeAnnotationEnd(toks []exponentToken, colonIdx int, srcLen int) int {
+	depth := 0
+	for i := colonIdx + 1; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.kind != exponentTokPunct {
+			continue
+		}
+		switch tok.text {
+		case "<", "[", "(":
+			depth++
+		case ">", "]", ")":
+			if depth == 0 {
+				return tok.start
+			}
+			depth--
+		case ",", "=", ";", "{":
+			if depth == 0 {
+				return tok.start
+			}
+		}
+	}
+	return srcLen
+}
+
+// maskImportExportClauses replaces every import/re-export clause in code
+// with a placeholder token, returning the masked code and a restore
+// function that substitutes the originals back in. This keeps regexes like
+// tsAsCastRe, which only know how to strip a TypeScript cast, from ever
+// seeing (and corrupting) the "as" in an ordinary module rename.
+func maskImportExportClauses(code string) (string, func(string) string) {
+	var saved []string
+	masked := tsImportExportClauseRe.ReplaceAllStringFunc(code, func(m string) string {
+		token := fmt.Sprintf("\x00TS_IMPORT_EXPORT_%d\x00", len(saved))
+		saved = append(saved, m)
+		return token
+	})
+
+	restore := func(s string) string {
+		for i, orig := range saved {
+			s = strings.ReplaceAll(s, fmt.Sprintf("\x00TS_IMPORT_EXPORT_%d\x00", i), orig)
+		}
+		return s
+	}
+	return masked, restore
+}
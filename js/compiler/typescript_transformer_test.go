@@ -0,0 +1,124 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2017 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTypeScriptTransformerRegexesCompile guards against the RE2 lookahead
+// panic: tsNonNullRe used to be written with `(?=...)`, which
+// regexp.MustCompile panics on at package-init time. If the package-level
+// var declaration were reintroduced with lookahead, loading this test
+// binary at all would already panic before this test body ran.
+func TestTypeScriptTransformerRegexesCompile(t *testing.T) {
+	t.Parallel()
+	require.NotNil(t, tsNonNullRe)
+}
+
+func TestTypeScriptTransformerStripsInterfacesAndTypes(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "interface Foo {\n  bar: string;\n}\ntype Baz = string | number;\nvar x = 1;\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, code, "interface")
+	require.NotContains(t, code, "type Baz")
+	require.Contains(t, code, "var x = 1;")
+}
+
+func TestTypeScriptTransformerStripsCastsAndNonNull(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "var a = (x as string);\nvar b = y!.z;\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "var a = (x);")
+	require.Contains(t, code, "var b = y.z;")
+}
+
+func TestTypeScriptTransformerPreservesImportRenames(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "import { foo as bar } from './m';\nconsole.log(bar);\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "import { foo as bar } from './m';", "plain ES module renaming must survive, not be mistaken for a type cast")
+	require.Contains(t, code, "console.log(bar);")
+}
+
+func TestTypeScriptTransformerPreservesNamespaceAndReexport(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "import * as ns from './m';\nexport { a as b } from './other';\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "import * as ns from './m';")
+	require.Contains(t, code, "export { a as b } from './other';")
+}
+
+func TestTypeScriptTransformerStripsOptionalParams(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "function f(a?: number) {\n  return;\n}\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "function f(a) {")
+}
+
+func TestTypeScriptTransformerStripsParamAndReturnTypesTogether(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "function f(a: string): void {}\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "function f(a){}")
+}
+
+func TestTypeScriptTransformerLeavesObjectLiteralsAlone(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "var tags = { status: res.status, body: res.body };\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "{ status: res.status, body: res.body }",
+		"an object literal's key: value pairs must survive untouched, not collapse into shorthand properties")
+}
+
+func TestTypeScriptTransformerLeavesCheckAssertionsAlone(t *testing.T) {
+	t.Parallel()
+
+	ts := newTypeScriptTransformer(nil)
+	src := "check(res, { status: res.status === 200 });\n"
+	code, _, err := ts.Transform(src, "script.ts", TransformOptions{})
+	require.NoError(t, err)
+	require.Contains(t, code, "status: res.status === 200",
+		"a check() assertion's key: value pair must stay intact, not be mangled into invalid syntax")
+}
@@ -23,6 +23,8 @@ package statsd
 import (
 	"bytes"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -39,7 +41,24 @@ type config struct {
 	Namespace    null.String        `json:"namespace,omitempty" envconfig:"K6_STATSD_NAMESPACE"`
 	PushInterval types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_STATSD_PUSH_INTERVAL"`
 	TagBlocklist stats.TagSet       `json:"tagBlocklist,omitempty" envconfig:"K6_STATSD_TAG_BLOCKLIST"`
-	TagFormat    nullTagFormatType  `json:"tagFormat,omitempty" envconfig:"K6_STATSD_TAG_FORMAT"`
+	// TagAllowlist, when non-empty, is the exact set of tags that may be
+	// emitted - everything else is dropped, the mirror image of
+	// TagBlocklist. It exists for downstreams with a strict cardinality
+	// budget, where pinning the allowed dimensions is safer than trying to
+	// keep an ever-growing blocklist in sync with every new k6 tag.
+	TagAllowlist stats.TagSet      `json:"tagAllowlist,omitempty" envconfig:"K6_STATSD_TAG_ALLOWLIST"`
+	TagFormat    nullTagFormatType `json:"tagFormat,omitempty" envconfig:"K6_STATSD_TAG_FORMAT"`
+
+	// TrendAsMetricType controls what metric type Trend metrics are sent as.
+	// It only has an effect when TagFormat is tagFormatDatadog, since "timer"
+	// is the only type plain statsd understands - histograms and
+	// distributions are DogStatsD extensions.
+	TrendAsMetricType nullTrendMetricType `json:"trendAsMetricType,omitempty" envconfig:"K6_STATSD_TREND_METRIC_TYPE"`
+	// SampleRate, if set, is appended to every metric line as a DogStatsD/
+	// statsd sampling rate (e.g. "|@0.1"), so agents that support it can
+	// extrapolate counts instead of k6 losing precision to UDP packet loss
+	// under high throughput.
+	SampleRate null.Float `json:"sampleRate,omitempty" envconfig:"K6_STATSD_SAMPLE_RATE"`
 }
 
 //go:generate enumer -type=tagFormatType -trimprefix tagFormat -transform snake -output tag_format_gen.go
@@ -52,18 +71,180 @@ const (
 	tagFormatDatadog
 	tagFormatNewrelic
 	tagFormatStatsdv2
+	// tagFormatInflux emits tags as InfluxDB line-protocol tag sets
+	// (metric,tag=value,tag2=value2:val|type), for telegraf's statsd input.
+	tagFormatInflux
+	// tagFormatSignalfx emits tags as SignalFx dimensions
+	// (metric[tag=value,tag2=value2]:val|type), for its collectd/statsd bridge.
+	tagFormatSignalfx
 )
 
-func processTags(t stats.TagSet, tags map[string]string) []string {
+//go:generate enumer -type=trendMetricType -trimprefix trendMetricType -transform snake -output trend_metric_type_gen.go
+
+// trendMetricType is the DogStatsD wire type k6 Trend metrics are emitted
+// as. Plain statsd only has timers; DogStatsD additionally supports
+// distributions and histograms, which preserve percentile fidelity on the
+// agent side instead of k6 pre-aggregating them away.
+type trendMetricType int
+
+const (
+	trendMetricTypeTimer trendMetricType = iota
+	trendMetricTypeHistogram
+	trendMetricTypeDistribution
+)
+
+// suffix returns the wire-format type suffix for m, e.g. "|ms".
+func (m trendMetricType) suffix() string {
+	switch m {
+	case trendMetricTypeHistogram:
+		return "|h"
+	case trendMetricTypeDistribution:
+		return "|d"
+	default:
+		return "|ms"
+	}
+}
+
+// nullTrendMetricType implements the null type around trendMetricType.
+type nullTrendMetricType struct {
+	t     trendMetricType
+	Valid bool
+}
+
+// UnmarshalText converts text data to a valid nullTrendMetricType.
+func (d *nullTrendMetricType) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		*d = nullTrendMetricType{}
+		return nil
+	}
+	var err error
+	d.t, err = trendMetricTypeString(string(data))
+	if err != nil {
+		return err
+	}
+	d.Valid = true
+	return nil
+}
+
+// UnmarshalJSON converts JSON data to a valid nullTrendMetricType.
+func (d *nullTrendMetricType) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte(`null`)) {
+		d.Valid = false
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	t, err := trendMetricTypeString(s)
+	if err != nil {
+		return err
+	}
+	d.t = t
+	d.Valid = true
+	return nil
+}
+
+// MarshalJSON returns the JSON representation of d.
+func (d nullTrendMetricType) MarshalJSON() ([]byte, error) {
+	if !d.Valid {
+		return []byte(`null`), nil
+	}
+	return json.Marshal(d.t)
+}
+
+// processTags filters tags by blocklist/allowlist and formats the survivors
+// as "key:value" pairs, the form tagFormatDatadog/tagFormatNewrelic/
+// tagFormatStatsdv2 all join with a "|#" prefix. An empty allowlist means
+// "no restriction"; a non-empty one means only those keys may pass, same as
+// TagBlocklist but inverted.
+func processTags(blocklist, allowlist stats.TagSet, tags map[string]string) []string {
 	var res []string
+	for key, value := range allowedTags(blocklist, allowlist, tags) {
+		res = append(res, key+":"+value)
+	}
+	return res
+}
+
+// allowedTags returns the subset of tags that isn't empty, isn't in
+// blocklist and, if allowlist is non-empty, is in allowlist.
+func allowedTags(blocklist, allowlist stats.TagSet, tags map[string]string) map[string]string {
+	res := make(map[string]string, len(tags))
 	for key, value := range tags {
-		if value != "" && !t[key] {
-			res = append(res, key+":"+value)
+		if value == "" || blocklist[key] {
+			continue
 		}
+		if len(allowlist) > 0 && !allowlist[key] {
+			continue
+		}
+		res[key] = value
 	}
 	return res
 }
 
+// formatInfluxTags renders tags as an InfluxDB line-protocol tag set, e.g.
+// ",tag=value,tag2=value2", ready to be inserted between the metric name
+// and the ":value|type" suffix. Per the line protocol, a literal comma,
+// space or equals sign in a tag key/value must be backslash-escaped so it
+// isn't mistaken for a delimiter.
+func formatInfluxTags(blocklist, allowlist stats.TagSet, tags map[string]string) string {
+	var b strings.Builder
+	for key, value := range allowedTags(blocklist, allowlist, tags) {
+		b.WriteByte(',')
+		b.WriteString(escapeInflux(key))
+		b.WriteByte('=')
+		b.WriteString(escapeInflux(value))
+	}
+	return b.String()
+}
+
+func escapeInflux(s string) string {
+	r := strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`)
+	return r.Replace(s)
+}
+
+// formatSignalfxTags renders tags as SignalFx dimensions, e.g.
+// "[tag=value,tag2=value2]", ready to be inserted right after the metric
+// name. Brackets and equals signs in a tag key/value are percent-escaped so
+// they can't be confused with the "[...]" dimension syntax itself.
+func formatSignalfxTags(blocklist, allowlist stats.TagSet, tags map[string]string) string {
+	filtered := allowedTags(blocklist, allowlist, tags)
+	if len(filtered) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('[')
+	first := true
+	for key, value := range filtered {
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		b.WriteString(escapeSignalfx(key))
+		b.WriteByte('=')
+		b.WriteString(escapeSignalfx(value))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func escapeSignalfx(s string) string {
+	r := strings.NewReplacer(`[`, `%5B`, `]`, `%5D`, `=`, `%3D`, `,`, `%2C`)
+	return r.Replace(s)
+}
+
+// sampleRateSuffix returns the "|@<rate>" wire suffix for rate, or "" for
+// the no-op rate of 1 (or anything <= 0/> 1, which isn't a valid sample
+// rate and is treated the same as "not set").
+func sampleRateSuffix(rate float64) string {
+	if rate <= 0 || rate >= 1 {
+		return ""
+	}
+	return "|@" + strconv.FormatFloat(rate, 'g', -1, 64)
+}
+
 // nullTagFormatType implements the null type around TagFormatType
 type nullTagFormatType struct {
 	t     tagFormatType
@@ -133,9 +314,18 @@ func (c config) Apply(cfg config) config {
 	if cfg.TagBlocklist != nil {
 		c.TagBlocklist = cfg.TagBlocklist
 	}
+	if cfg.TagAllowlist != nil {
+		c.TagAllowlist = cfg.TagAllowlist
+	}
 	if cfg.TagFormat.Valid {
 		c.TagFormat = cfg.TagFormat
 	}
+	if cfg.TrendAsMetricType.Valid {
+		c.TrendAsMetricType = cfg.TrendAsMetricType
+	}
+	if cfg.SampleRate.Valid {
+		c.SampleRate = cfg.SampleRate
+	}
 
 	return c
 }
@@ -149,6 +339,9 @@ func newConfig() config {
 		PushInterval: types.NewNullDuration(1*time.Second, false),
 		TagBlocklist: stats.TagSet{},
 		TagFormat:    nullTagFormatType{t: tagFormatNone},
+
+		TrendAsMetricType: nullTrendMetricType{t: trendMetricTypeTimer},
+		SampleRate:        null.NewFloat(1, false),
 	}
 }
 
@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleRateSuffix(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "", sampleRateSuffix(1))
+	require.Equal(t, "", sampleRateSuffix(0))
+	require.Equal(t, "", sampleRateSuffix(-0.5))
+	require.Equal(t, "", sampleRateSuffix(1.5))
+	require.Equal(t, "|@0.1", sampleRateSuffix(0.1))
+}
+
+func TestTrendMetricTypeSuffix(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "|ms", trendMetricTypeTimer.suffix())
+	require.Equal(t, "|h", trendMetricTypeHistogram.suffix())
+	require.Equal(t, "|d", trendMetricTypeDistribution.suffix())
+}
+
+func TestConfigApplyOverridesOnlyValidFields(t *testing.T) {
+	t.Parallel()
+
+	base := newConfig()
+	override := config{SampleRate: base.SampleRate}
+	override.SampleRate.Float64 = 0.5
+	override.SampleRate.Valid = true
+
+	merged := base.Apply(override)
+	require.True(t, merged.SampleRate.Valid)
+	require.InDelta(t, 0.5, merged.SampleRate.Float64, 0.0001)
+	// everything else must be left at its default since override didn't set it.
+	require.Equal(t, base.Addr, merged.Addr)
+	require.Equal(t, base.TagFormat, merged.TagFormat)
+}
@@ -0,0 +1,104 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestAllowedTagsBlocklist(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"method": "GET", "status": "200", "url": "http://x"}
+	got := allowedTags(stats.TagSet{"url": true}, nil, tags)
+	require.Equal(t, map[string]string{"method": "GET", "status": "200"}, got)
+}
+
+func TestAllowedTagsAllowlist(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"method": "GET", "status": "200", "url": "http://x"}
+	got := allowedTags(nil, stats.TagSet{"method": true}, tags)
+	require.Equal(t, map[string]string{"method": "GET"}, got)
+}
+
+func TestAllowedTagsDropsEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"method": "GET", "status": ""}
+	got := allowedTags(nil, nil, tags)
+	require.Equal(t, map[string]string{"method": "GET"}, got)
+}
+
+func TestAllowedTagsBlocklistWinsOverAllowlist(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"method": "GET"}
+	got := allowedTags(stats.TagSet{"method": true}, stats.TagSet{"method": true}, tags)
+	require.Empty(t, got)
+}
+
+func TestProcessTags(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"method": "GET"}
+	got := processTags(nil, nil, tags)
+	require.Equal(t, []string{"method:GET"}, got)
+}
+
+func TestEscapeInflux(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `a\,b\=c\ d`, escapeInflux("a,b=c d"))
+}
+
+func TestFormatInfluxTags(t *testing.T) {
+	t.Parallel()
+
+	got := formatInfluxTags(nil, nil, map[string]string{"method": "GET"})
+	require.Equal(t, ",method=GET", got)
+}
+
+func TestFormatInfluxTagsEscapesSpecialChars(t *testing.T) {
+	t.Parallel()
+
+	got := formatInfluxTags(nil, nil, map[string]string{"url": "a,b c"})
+	require.Equal(t, `,url=a\,b\ c`, got)
+}
+
+func TestEscapeSignalfx(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `a%5Bb%5D%3Dc%2Cd`, escapeSignalfx("a[b]=c,d"))
+}
+
+func TestFormatSignalfxTagsEmpty(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "", formatSignalfxTags(nil, nil, map[string]string{"status": ""}))
+}
+
+func TestFormatSignalfxTags(t *testing.T) {
+	t.Parallel()
+	got := formatSignalfxTags(nil, nil, map[string]string{"method": "GET"})
+	require.Equal(t, "[method=GET]", got)
+}
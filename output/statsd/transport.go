@@ -0,0 +1,92 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// dialAddr holds everything net.Dial (or net.DialUnix) needs to reach the
+// configured agent, having already worked out the network family from
+// config.Addr.
+type dialAddr struct {
+	network string
+	address string
+}
+
+// parseAddr turns a config.Addr value into the network/address pair Dial
+// needs. Three forms are accepted:
+//
+//	host:port                 -> udp, unchanged (the historical default)
+//	unix:///path/to.sock      -> unixgram (datagram) socket at /path/to.sock
+//	unixgram:///path/to.sock  -> unixgram (datagram) socket at /path/to.sock
+//
+// DogStatsD and statsd_exporter both listen on a unixgram socket by
+// convention, so that's what plain "unix://" is treated as too - there's no
+// widely-used stream-oriented statsd agent to disambiguate against.
+func parseAddr(addr string) (dialAddr, error) {
+	switch {
+	case strings.HasPrefix(addr, "unixgram://"):
+		return dialAddr{network: "unixgram", address: strings.TrimPrefix(addr, "unixgram://")}, nil
+	case strings.HasPrefix(addr, "unix://"):
+		return dialAddr{network: "unixgram", address: strings.TrimPrefix(addr, "unix://")}, nil
+	case strings.Contains(addr, "://"):
+		return dialAddr{}, fmt.Errorf("unsupported statsd address scheme in %q, expected host:port, unix:// or unixgram://", addr)
+	default:
+		return dialAddr{network: "udp", address: addr}, nil
+	}
+}
+
+// Dial connects to the statsd/DogStatsD agent described by addr (as
+// accepted by parseAddr), returning a net.Conn ready to have metric lines
+// written to it.
+//
+// Unix domain sockets are datagram-oriented here, same as UDP, so unlike a
+// TCP connection there's no Nagle-style coalescing to disable; BufferSize
+// still controls how many lines config.BufferSize batches before a single
+// Write, which applies equally to both transports.
+func Dial(addr string) (net.Conn, error) {
+	da, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch da.network {
+	case "unixgram":
+		raddr, err := net.ResolveUnixAddr("unixgram", da.address)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't resolve statsd unix socket address %q: %w", da.address, err)
+		}
+		conn, err := net.DialUnix("unixgram", nil, raddr)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't dial statsd unix socket %q: %w", da.address, err)
+		}
+		return conn, nil
+	default:
+		conn, err := net.Dial(da.network, da.address)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't dial statsd address %q: %w", da.address, err)
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddrUDP(t *testing.T) {
+	t.Parallel()
+
+	da, err := parseAddr("localhost:8125")
+	require.NoError(t, err)
+	require.Equal(t, dialAddr{network: "udp", address: "localhost:8125"}, da)
+}
+
+func TestParseAddrUnix(t *testing.T) {
+	t.Parallel()
+
+	da, err := parseAddr("unix:///tmp/statsd.sock")
+	require.NoError(t, err)
+	require.Equal(t, dialAddr{network: "unixgram", address: "/tmp/statsd.sock"}, da)
+}
+
+func TestParseAddrUnixgram(t *testing.T) {
+	t.Parallel()
+
+	da, err := parseAddr("unixgram:///tmp/statsd.sock")
+	require.NoError(t, err)
+	require.Equal(t, dialAddr{network: "unixgram", address: "/tmp/statsd.sock"}, da)
+}
+
+func TestParseAddrUnsupportedScheme(t *testing.T) {
+	t.Parallel()
+
+	_, err := parseAddr("tcp://localhost:8125")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported statsd address scheme")
+}
+
+func TestDialUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	sockPath := filepath.Join(t.TempDir(), "statsd.sock")
+	laddr, err := net.ResolveUnixAddr("unixgram", sockPath)
+	require.NoError(t, err)
+	listener, err := net.ListenUnixgram("unixgram", laddr)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := Dial("unix://" + sockPath)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("k6.test:1|c"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 64)
+	n, err := listener.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "k6.test:1|c", string(buf[:n]))
+}
+
+func TestDialUnsupportedScheme(t *testing.T) {
+	t.Parallel()
+
+	_, err := Dial("tcp://localhost:8125")
+	require.Error(t, err)
+}